@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// cacheEntry tracks where a cached GCS object landed on disk, plus the
+// metadata needed to tell whether the remote object has since changed.
+type cacheEntry struct {
+	localPath  string
+	etag       string
+	generation int64
+}
+
+// Cache is an LRU disk cache for GCS downloads, keyed by the fully
+// qualified GCS path. Release tooling repeatedly re-fetches the same
+// version markers and stage artifacts during a single run; Cache lets
+// those re-fetches reuse what's already on disk instead of re-downloading.
+type Cache struct {
+	location string
+	opts     *Options
+	client   Client
+
+	mu    sync.Mutex
+	items *lru.Cache
+}
+
+// NewCache creates a Cache that stores downloaded objects under location,
+// keeping at most capacity of them on disk. When capacity is exceeded, the
+// least-recently-used entry is evicted and its file removed.
+func NewCache(location string, capacity int) (*Cache, error) {
+	if err := os.MkdirAll(location, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "creating cache directory %s", location)
+	}
+
+	c := &Cache{
+		location: location,
+		opts:     DefaultGCSCopyOptions,
+		client:   NewClient(DefaultGCSCopyOptions),
+	}
+
+	items, err := lru.NewWithEvict(capacity, func(key, value interface{}) {
+		entry, ok := value.(cacheEntry)
+		if !ok {
+			return
+		}
+		logrus.Debugf("Evicting cache entry %s (%s)", key, entry.localPath)
+		if err := os.Remove(entry.localPath); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Unable to remove evicted cache file %s: %v", entry.localPath, err)
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "creating LRU cache")
+	}
+	c.items = items
+
+	return c, nil
+}
+
+// Get returns a local path to the contents of gcsPath, downloading it if
+// it isn't already cached or if the cached copy is stale. Staleness is
+// checked cheaply via the object's ETag and generation, so repeated calls
+// for an unchanged object only pay the cost of a Stat; only the LRU
+// bookkeeping is serialized, so Stat/download for distinct keys still run
+// concurrently.
+func (c *Cache) Get(gcsPath string) (localPath string, err error) {
+	gcsPath = NormalizeGCSPath(gcsPath)
+
+	attrs, err := c.client.Stat(gcsPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "statting %s", gcsPath)
+	}
+
+	if entry, fresh := c.validEntry(gcsPath, attrs); fresh {
+		return entry.localPath, nil
+	}
+
+	dest := filepath.Join(c.location, uuid.New().String())
+	if err := withRetry(c.opts.ReadRetryPolicy, "cache fetch", func() error {
+		return c.client.Copy(gcsPath, dest, c.opts)
+	}); err != nil {
+		return "", errors.Wrapf(err, "downloading %s", gcsPath)
+	}
+
+	c.mu.Lock()
+	c.items.Add(gcsPath, cacheEntry{
+		localPath:  dest,
+		etag:       attrs.ETag,
+		generation: attrs.Generation,
+	})
+	c.mu.Unlock()
+
+	return dest, nil
+}
+
+// validEntry returns the cached entry for gcsPath and whether it's still
+// fresh: its ETag and generation both still match attrs, and its local
+// file hasn't since been removed.
+func (c *Cache) validEntry(gcsPath string, attrs *ObjectAttrs) (entry cacheEntry, fresh bool) {
+	c.mu.Lock()
+	cached, ok := c.items.Get(gcsPath)
+	c.mu.Unlock()
+	if !ok {
+		return cacheEntry{}, false
+	}
+
+	entry = cached.(cacheEntry)
+	if entry.generation != attrs.Generation || entry.etag != attrs.ETag {
+		logrus.Debugf("Cache entry for %s is stale, re-fetching", gcsPath)
+		return entry, false
+	}
+
+	if _, statErr := os.Stat(entry.localPath); statErr != nil {
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// Remove evicts gcsPath from the cache, if present, deleting its local
+// file.
+func (c *Cache) Remove(gcsPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items.Remove(NormalizeGCSPath(gcsPath))
+}
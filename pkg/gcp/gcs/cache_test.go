@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestCacheEntry writes a file under the cache's location and inserts a
+// cacheEntry for it directly, bypassing Get (and the network Stat/download
+// it requires) so eviction behavior can be tested in isolation.
+func newTestCacheEntry(t *testing.T, c *Cache, key string) cacheEntry {
+	t.Helper()
+
+	path := filepath.Join(c.location, key+"-file")
+	if err := ioutil.WriteFile(path, []byte(key), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := cacheEntry{localPath: path, generation: 1}
+	c.mu.Lock()
+	c.items.Add(key, entry)
+	c.mu.Unlock()
+
+	return entry
+}
+
+func TestCacheEvictsLeastRecentlyUsedAndUnlinksFile(t *testing.T) {
+	c, err := NewCache(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestCacheEntry(t, c, "a")
+	newTestCacheEntry(t, c, "b")
+
+	// Touch "a" so "b" becomes the least-recently-used entry.
+	c.mu.Lock()
+	c.items.Get("a")
+	c.mu.Unlock()
+
+	newTestCacheEntry(t, c, "c")
+
+	c.mu.Lock()
+	_, aStillCached := c.items.Get("a")
+	_, bStillCached := c.items.Get("b")
+	_, cStillCached := c.items.Get("c")
+	c.mu.Unlock()
+
+	if !aStillCached {
+		t.Error("expected recently-used entry \"a\" to survive eviction")
+	}
+	if bStillCached {
+		t.Error("expected least-recently-used entry \"b\" to be evicted")
+	}
+	if !cStillCached {
+		t.Error("expected newly-added entry \"c\" to be present")
+	}
+
+	if _, statErr := os.Stat(a.localPath); statErr != nil {
+		t.Errorf("surviving entry's file should still exist: %v", statErr)
+	}
+
+	evictedPath := filepath.Join(c.location, "b-file")
+	if _, statErr := os.Stat(evictedPath); !os.IsNotExist(statErr) {
+		t.Errorf("evicted entry's file should have been removed, stat err = %v", statErr)
+	}
+}
+
+func TestCacheValidEntryRejectsETagMismatch(t *testing.T) {
+	c, err := NewCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(c.location, "obj-file")
+	if err := ioutil.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	c.items.Add("gs://bucket/obj", cacheEntry{localPath: path, etag: "etag-1", generation: 1})
+	c.mu.Unlock()
+
+	if _, fresh := c.validEntry("gs://bucket/obj", &ObjectAttrs{ETag: "etag-1", Generation: 1}); !fresh {
+		t.Error("expected matching ETag and generation to be considered fresh")
+	}
+
+	if _, fresh := c.validEntry("gs://bucket/obj", &ObjectAttrs{ETag: "etag-2", Generation: 1}); fresh {
+		t.Error("expected a changed ETag to invalidate the cache entry even with the same generation")
+	}
+}
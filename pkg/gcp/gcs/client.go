@@ -0,0 +1,535 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
+	"k8s.io/release/pkg/gcp"
+)
+
+// defaultConcurrentWorkers is the number of goroutines the native client
+// uses to fan out object copies, mirroring gsutil's `-m` behavior.
+const defaultConcurrentWorkers = 30
+
+// Client is the interface implemented by the backends this package can use
+// to talk to GCS. It exists so that `pkg/gcs` can run without the gcloud SDK
+// being installed on the host: the native implementation only needs
+// Application Default Credentials, while the gsutil implementation shells
+// out to the `gsutil` binary.
+type Client interface {
+	// Copy copies src to dst. Both paths are expected to already carry the
+	// `gs://` prefix (see NormalizeGCSPath) when they refer to GCS objects;
+	// local paths are passed through unmodified.
+	Copy(src, dst string, opts *Options) error
+
+	// Rsync recursively synchronizes src into dst.
+	Rsync(src, dst string) error
+
+	// Exists returns true if gcsPath exists.
+	Exists(gcsPath string) (bool, error)
+
+	// List returns the names of the objects found under gcsPath.
+	List(gcsPath string) ([]string, error)
+
+	// Delete removes gcsPath.
+	Delete(gcsPath string) error
+
+	// Stat returns metadata about a single GCS object.
+	Stat(gcsPath string) (*ObjectAttrs, error)
+}
+
+// ObjectAttrs carries the subset of GCS object metadata this package cares
+// about, independent of which client backend produced it.
+type ObjectAttrs struct {
+	Name       string
+	Size       int64
+	ETag       string
+	Generation int64
+}
+
+// gsutilClient is the historical Client implementation: every operation
+// shells out to the `gsutil` CLI via gcp.GSUtil.
+type gsutilClient struct{}
+
+// nativeClient implements Client on top of cloud.google.com/go/storage using
+// Application Default Credentials, so it works on hosts without the gcloud
+// SDK installed.
+type nativeClient struct {
+	ctx     context.Context
+	workers int
+}
+
+// NewClient returns the Client backend selected by opts. The native backend
+// is used by default; set opts.UseGsutil to fall back to the gsutil CLI,
+// for example on hosts where ADC isn't configured but gcloud already is.
+func NewClient(opts *Options) Client {
+	if opts != nil && opts.UseGsutil != nil && *opts.UseGsutil {
+		logrus.Debug("Using gsutil GCS client backend")
+		return &gsutilClient{}
+	}
+
+	workers := defaultConcurrentWorkers
+	if opts != nil && opts.ConcurrentWorkers != nil {
+		workers = *opts.ConcurrentWorkers
+	}
+
+	logrus.Debug("Using native GCS client backend")
+	return &nativeClient{ctx: context.Background(), workers: workers}
+}
+
+func (c *gsutilClient) Copy(src, dst string, opts *Options) error {
+	return gsutilCopy(src, dst, opts)
+}
+
+func (c *gsutilClient) Rsync(src, dst string) error {
+	return errors.Wrap(
+		gcp.GSUtil(concurrentFlag, "rsync", recursiveFlag, src, dst),
+		"running gsutil rsync",
+	)
+}
+
+func (c *gsutilClient) Exists(gcsPath string) (bool, error) {
+	if err := gcp.GSUtil("ls", gcsPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *gsutilClient) List(gcsPath string) ([]string, error) {
+	return nil, errors.New("listing is not implemented for the gsutil client backend")
+}
+
+func (c *gsutilClient) Delete(gcsPath string) error {
+	return errors.Wrap(gcp.GSUtil("rm", gcsPath), "running gsutil rm")
+}
+
+func (c *gsutilClient) Stat(gcsPath string) (*ObjectAttrs, error) {
+	return nil, errors.New("stat is not implemented for the gsutil client backend")
+}
+
+// bucketAndObject splits a normalized `gs://bucket/object` path into its
+// bucket and object components.
+func bucketAndObject(gcsPath string) (bucket, object string) {
+	trimmed := strings.TrimPrefix(gcsPath, GcsPrefix)
+	parts := strings.SplitN(trimmed, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (c *nativeClient) storageClient() (*storage.Client, error) {
+	client, err := storage.NewClient(c.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating native GCS client")
+	}
+	return client, nil
+}
+
+// Copy streams src to dst using the native storage client, fanning the work
+// out across c.workers goroutines when either side expands to multiple
+// objects, to preserve the semantics of gsutil's `-m -r` flags: a local
+// directory uploads every file it contains, a GCS prefix downloads every
+// object under it, and a GCS-to-GCS copy fans out over every object in the
+// source prefix.
+func (c *nativeClient) Copy(src, dst string, opts *Options) error {
+	client, err := c.storageClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	srcIsGCS := strings.HasPrefix(src, GcsPrefix)
+	dstIsGCS := strings.HasPrefix(dst, GcsPrefix)
+	recursive := opts != nil && opts.Recursive != nil && *opts.Recursive
+
+	switch {
+	case srcIsGCS && !dstIsGCS:
+		if !recursive {
+			return c.download(client, src, dst, opts)
+		}
+		return c.downloadPrefix(client, src, dst, opts)
+	case !srcIsGCS && dstIsGCS:
+		info, statErr := os.Stat(src)
+		if statErr != nil {
+			return errors.Wrapf(statErr, "statting %s", src)
+		}
+		if !info.IsDir() {
+			return c.upload(client, src, dst, opts)
+		}
+		return c.uploadDir(client, src, dst, opts)
+	case srcIsGCS && dstIsGCS:
+		if !recursive {
+			return c.copyObject(client, src, dst, opts)
+		}
+		return c.copyPrefix(client, src, dst, opts)
+	default:
+		return errors.New("at least one of src or dst must be a gs:// path")
+	}
+}
+
+// isPreconditionFailed reports whether err is the googleapi 412 returned
+// when a NoClobber write's `DoesNotExist` precondition fails because the
+// destination object already exists.
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+func (c *nativeClient) download(client *storage.Client, gcsPath, dst string, opts *Options) error {
+	bucket, object := bucketAndObject(gcsPath)
+
+	r, err := client.Bucket(bucket).Object(object).NewReader(c.ctx)
+	if err != nil {
+		if opts.allowMissing() && errors.Is(err, storage.ErrObjectNotExist) {
+			logrus.Infof("%s does not exist. Skipping download.", gcsPath)
+			return nil
+		}
+		return errors.Wrapf(err, "opening reader for %s", gcsPath)
+	}
+	defer r.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dst)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return errors.Wrapf(err, "downloading %s to %s", gcsPath, dst)
+	}
+
+	return nil
+}
+
+func (c *nativeClient) upload(client *storage.Client, src, gcsPath string, opts *Options) error {
+	bucket, object := bucketAndObject(gcsPath)
+
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", src)
+	}
+	defer f.Close()
+
+	obj := client.Bucket(bucket).Object(object)
+	if opts.noClobber() {
+		obj = obj.If(storage.Conditions{DoesNotExist: true})
+	}
+
+	w := obj.NewWriter(c.ctx)
+	if _, err := io.Copy(w, f); err != nil {
+		w.Close()
+		return errors.Wrapf(err, "uploading %s to %s", src, gcsPath)
+	}
+
+	if err := w.Close(); err != nil {
+		if opts.noClobber() && isPreconditionFailed(err) {
+			logrus.Infof("%s already exists. Skipping upload (NoClobber).", gcsPath)
+			return nil
+		}
+		return errors.Wrapf(err, "closing upload of %s", gcsPath)
+	}
+
+	return nil
+}
+
+// listNames returns the full (non-prefix-trimmed) names of every object
+// under gs://bucket/prefix.
+func (c *nativeClient) listNames(client *storage.Client, bucket, prefix string) ([]string, error) {
+	it := client.Bucket(bucket).Objects(c.ctx, &storage.Query{Prefix: prefix})
+
+	names := []string{}
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing gs://%s/%s", bucket, prefix)
+		}
+		names = append(names, attrs.Name)
+	}
+
+	return names, nil
+}
+
+// downloadPrefix downloads every object under the GCS prefix gcsPath into
+// dst, preserving relative paths, fanning the downloads out across
+// c.workers goroutines.
+func (c *nativeClient) downloadPrefix(client *storage.Client, gcsPath, dst string, opts *Options) error {
+	bucket, prefix := bucketAndObject(gcsPath)
+
+	names, err := c.listNames(client, bucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]func() error, len(names))
+	for i, name := range names {
+		name := name
+		jobs[i] = func() error {
+			rel := strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+			target := filepath.Join(dst, rel)
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			return withRetry(opts.readRetryPolicy(), "gcs download", func() error {
+				return c.download(client, GcsPrefix+bucket+"/"+name, target, opts)
+			})
+		}
+	}
+
+	return runWorkerPool(c.workers, jobs)
+}
+
+// uploadDir walks the local directory src and uploads every regular file it
+// contains to the GCS prefix gcsPath, preserving relative paths, fanning
+// the uploads out across c.workers goroutines.
+func (c *nativeClient) uploadDir(client *storage.Client, src, gcsPath string, opts *Options) error {
+	paths := []string{}
+	if err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "walking %s", src)
+	}
+
+	prefix := strings.TrimPrefix(gcsPath, GcsPrefix)
+
+	jobs := make([]func() error, len(paths))
+	for i, path := range paths {
+		path := path
+		jobs[i] = func() error {
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			dest := NormalizeGCSPath(filepath.Join(prefix, rel))
+			return withRetry(opts.writeRetryPolicy(), "gcs upload", func() error {
+				return c.upload(client, path, dest, opts)
+			})
+		}
+	}
+
+	return runWorkerPool(c.workers, jobs)
+}
+
+// copyPrefix copies every object under the GCS prefix src to the
+// corresponding object under the GCS prefix dst, fanning the copies out
+// across c.workers goroutines.
+func (c *nativeClient) copyPrefix(client *storage.Client, src, dst string, opts *Options) error {
+	bucket, prefix := bucketAndObject(src)
+
+	names, err := c.listNames(client, bucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]func() error, len(names))
+	for i, name := range names {
+		name := name
+		jobs[i] = func() error {
+			rel := strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+			srcObj := GcsPrefix + bucket + "/" + name
+			dstObj := NormalizeGCSPath(strings.TrimSuffix(dst, "/") + "/" + rel)
+			return withRetry(opts.writeRetryPolicy(), "gcs copy", func() error {
+				return c.copyObject(client, srcObj, dstObj, opts)
+			})
+		}
+	}
+
+	return runWorkerPool(c.workers, jobs)
+}
+
+func (c *nativeClient) copyObject(client *storage.Client, src, dst string, opts *Options) error {
+	srcBucket, srcObject := bucketAndObject(src)
+	dstBucket, dstObject := bucketAndObject(dst)
+
+	srcHandle := client.Bucket(srcBucket).Object(srcObject)
+	dstHandle := client.Bucket(dstBucket).Object(dstObject)
+	if opts.noClobber() {
+		dstHandle = dstHandle.If(storage.Conditions{DoesNotExist: true})
+	}
+
+	if _, err := dstHandle.CopierFrom(srcHandle).Run(c.ctx); err != nil {
+		if opts.noClobber() && isPreconditionFailed(err) {
+			logrus.Infof("%s already exists. Skipping copy (NoClobber).", dst)
+			return nil
+		}
+		return errors.Wrapf(err, "copying %s to %s", src, dst)
+	}
+
+	return nil
+}
+
+func (c *nativeClient) Rsync(src, dst string) error {
+	return errors.New("rsync is not yet implemented for the native GCS client backend")
+}
+
+func (c *nativeClient) Exists(gcsPath string) (bool, error) {
+	_, err := c.Stat(gcsPath)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns the names of the objects found under gcsPath, relative to
+// gcsPath itself, matching the convention used by the S3 and Azure
+// backends in pkg/objstore so that callers can join a listed name back
+// onto either a source or destination prefix.
+func (c *nativeClient) List(gcsPath string) ([]string, error) {
+	client, err := c.storageClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	bucket, prefix := bucketAndObject(gcsPath)
+	names, err := c.listNames(client, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := make([]string, len(names))
+	for i, name := range names {
+		rel[i] = strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+	}
+
+	return rel, nil
+}
+
+func (c *nativeClient) Delete(gcsPath string) error {
+	client, err := c.storageClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	bucket, object := bucketAndObject(gcsPath)
+	return errors.Wrapf(
+		client.Bucket(bucket).Object(object).Delete(c.ctx),
+		"deleting %s", gcsPath,
+	)
+}
+
+// readCloserWithClient closes the underlying storage.Client once the
+// object reader it owns is closed, since each NewReader/NewWriter call
+// opens its own client rather than sharing the one used for the request
+// that created it.
+type readCloserWithClient struct {
+	io.ReadCloser
+	client *storage.Client
+}
+
+func (r *readCloserWithClient) Close() error {
+	err := r.ReadCloser.Close()
+	if cerr := r.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type writeCloserWithClient struct {
+	io.WriteCloser
+	client *storage.Client
+}
+
+func (w *writeCloserWithClient) Close() error {
+	err := w.WriteCloser.Close()
+	if cerr := w.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewReader opens a streaming reader for a single GCS object, always using
+// the native storage client regardless of Options.UseGsutil — gsutil has
+// no streaming API suitable for the cross-backend copies pkg/objstore
+// needs this for.
+func NewReader(gcsPath string) (io.ReadCloser, error) {
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating native GCS client")
+	}
+
+	bucket, object := bucketAndObject(NormalizeGCSPath(gcsPath))
+	r, err := client.Bucket(bucket).Object(object).NewReader(context.Background())
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrapf(err, "opening reader for %s", gcsPath)
+	}
+
+	return &readCloserWithClient{r, client}, nil
+}
+
+// NewWriter opens a streaming writer for a single GCS object. Closing the
+// writer finalizes the upload. It always uses the native storage client,
+// for the same reason as NewReader.
+func NewWriter(gcsPath string) (io.WriteCloser, error) {
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating native GCS client")
+	}
+
+	bucket, object := bucketAndObject(NormalizeGCSPath(gcsPath))
+	w := client.Bucket(bucket).Object(object).NewWriter(context.Background())
+
+	return &writeCloserWithClient{w, client}, nil
+}
+
+func (c *nativeClient) Stat(gcsPath string) (*ObjectAttrs, error) {
+	client, err := c.storageClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	bucket, object := bucketAndObject(gcsPath)
+	attrs, err := client.Bucket(bucket).Object(object).Attrs(c.ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "statting %s", gcsPath)
+	}
+
+	return &ObjectAttrs{
+		Name:       attrs.Name,
+		Size:       attrs.Size,
+		ETag:       attrs.Etag,
+		Generation: attrs.Generation,
+	}, nil
+}
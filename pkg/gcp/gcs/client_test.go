@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import "testing"
+
+func TestBucketAndObject(t *testing.T) {
+	cases := []struct {
+		name       string
+		gcsPath    string
+		wantBucket string
+		wantObject string
+	}{
+		{
+			name:       "bucket and object",
+			gcsPath:    "gs://my-bucket/path/to/object.txt",
+			wantBucket: "my-bucket",
+			wantObject: "path/to/object.txt",
+		},
+		{
+			name:       "bucket only",
+			gcsPath:    "gs://my-bucket",
+			wantBucket: "my-bucket",
+			wantObject: "",
+		},
+		{
+			name:       "bucket with trailing slash",
+			gcsPath:    "gs://my-bucket/",
+			wantBucket: "my-bucket",
+			wantObject: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			bucket, object := bucketAndObject(tc.gcsPath)
+			if bucket != tc.wantBucket {
+				t.Errorf("bucket = %q, want %q", bucket, tc.wantBucket)
+			}
+			if object != tc.wantObject {
+				t.Errorf("object = %q, want %q", object, tc.wantObject)
+			}
+		})
+	}
+}
@@ -48,6 +48,46 @@ type Options struct {
 	// operations happen in a loop/channel, so a single "failure" does not block
 	// the entire operation.
 	AllowMissing *bool
+
+	// UseGsutil selects the gsutil CLI backend instead of the native
+	// cloud.google.com/go/storage client. Off by default so that callers
+	// work on hosts without the gcloud SDK installed.
+	UseGsutil *bool
+
+	// ConcurrentWorkers controls how many goroutines the native client
+	// backend uses to fan out object copies. Defaults to
+	// defaultConcurrentWorkers when nil.
+	ConcurrentWorkers *int
+
+	// ReadRetryPolicy governs retries for operations that only read from
+	// GCS. A nil policy disables retries.
+	ReadRetryPolicy *RetryPolicy
+
+	// WriteRetryPolicy governs retries for operations that mutate GCS. A
+	// nil policy disables retries.
+	WriteRetryPolicy *RetryPolicy
+}
+
+func (o *Options) noClobber() bool {
+	return o != nil && o.NoClobber != nil && *o.NoClobber
+}
+
+func (o *Options) allowMissing() bool {
+	return o != nil && o.AllowMissing != nil && *o.AllowMissing
+}
+
+func (o *Options) readRetryPolicy() *RetryPolicy {
+	if o == nil {
+		return nil
+	}
+	return o.ReadRetryPolicy
+}
+
+func (o *Options) writeRetryPolicy() *RetryPolicy {
+	if o == nil {
+		return nil
+	}
+	return o.WriteRetryPolicy
 }
 
 // DefaultGCSCopyOptions have the default options for the GCS copy action
@@ -56,6 +96,10 @@ var DefaultGCSCopyOptions = &Options{
 	Recursive:    pointer.BoolPtr(true),
 	NoClobber:    pointer.BoolPtr(true),
 	AllowMissing: pointer.BoolPtr(true),
+	UseGsutil:    pointer.BoolPtr(false),
+
+	ReadRetryPolicy:  DefaultReadRetryPolicy,
+	WriteRetryPolicy: DefaultWriteRetryPolicy,
 }
 
 // CopyToGCS copies a local directory to the specified GCS path
@@ -93,6 +137,47 @@ func CopyBucketToBucket(src, dst string, opts *Options) error {
 }
 
 func bucketCopy(src, dst string, opts *Options) error {
+	useGsutil := opts.UseGsutil != nil && *opts.UseGsutil
+	recursive := opts.Recursive != nil && *opts.Recursive
+
+	// A single local file is uploaded directly rather than through the
+	// native backend's worker pool, so it takes the retry path below.
+	singleLocalFile := false
+	if !strings.HasPrefix(src, GcsPrefix) {
+		if info, err := os.Stat(src); err == nil && !info.IsDir() {
+			singleLocalFile = true
+		}
+	}
+
+	if !useGsutil && recursive && !singleLocalFile {
+		// The native backend already retries each object's job
+		// individually inside its worker pool (see nativeClient.Copy's
+		// downloadPrefix/uploadDir/copyPrefix), so a transient failure
+		// partway through a large prefix copy doesn't re-run the whole
+		// copy -- including re-downloading/re-uploading objects NoClobber
+		// would otherwise have skipped the second time around.
+		return NewClient(opts).Copy(src, dst, opts)
+	}
+
+	policy := opts.WriteRetryPolicy
+	if strings.HasPrefix(src, GcsPrefix) && !strings.HasPrefix(dst, GcsPrefix) {
+		// A pure download only reads from GCS.
+		policy = opts.ReadRetryPolicy
+	}
+
+	return withRetry(policy, "gcs copy", func() error {
+		if !useGsutil {
+			return NewClient(opts).Copy(src, dst, opts)
+		}
+
+		return gsutilCopy(src, dst, opts)
+	})
+}
+
+// gsutilCopy is the historical gsutil-backed implementation of Copy, kept
+// separate so the gsutilClient backend can call it without recursing
+// through bucketCopy's backend selection.
+func gsutilCopy(src, dst string, opts *Options) error {
 	args := []string{}
 
 	if *opts.Concurrent {
@@ -193,24 +278,31 @@ func NormalizeGCSPath(gcsPath string) string {
 
 // RsyncRecursive runs `gsutil rsync` in recursive mode. The caller of this
 // function has to ensure that the provided paths are prefixed with gs:// if
-// necessary (see `NormalizeGCSPath()`).
+// necessary (see `NormalizeGCSPath()`). Transient failures are retried
+// using DefaultGCSCopyOptions.WriteRetryPolicy.
 func RsyncRecursive(src, dst string) error {
-	return errors.Wrap(
-		gcp.GSUtil("-m", "rsync", "-r", src, dst),
-		"running gsutil rsync",
-	)
+	return withRetry(DefaultGCSCopyOptions.WriteRetryPolicy, "gsutil rsync", func() error {
+		return errors.Wrap(
+			gcp.GSUtil("-m", "rsync", "-r", src, dst),
+			"running gsutil rsync",
+		)
+	})
 }
 
-// PathExists returns true if the specified GCS path exists.
+// PathExists returns true if the specified GCS path exists. Transient
+// failures are retried using DefaultGCSCopyOptions.ReadRetryPolicy.
 func PathExists(gcsPath string) (bool, error) {
-	err := gcp.GSUtil(
-		"ls",
-		gcsPath,
-	)
+	var found bool
+
+	err := withRetry(DefaultGCSCopyOptions.ReadRetryPolicy, "gsutil ls", func() error {
+		err := gcp.GSUtil("ls", gcsPath)
+		found = err == nil
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
 
 	logrus.Infof("Found %s", gcsPath)
-	return true, nil
+	return found, nil
 }
@@ -0,0 +1,479 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha1" // nolint:gosec // manifests use SHA1 for parity with gcs-fetcher, not for security
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ManifestEntry describes a single file tracked by a release manifest: its
+// location in GCS, the local path it should be written to (or read from),
+// its size, and a SHA1 checksum used to verify transfers.
+type ManifestEntry struct {
+	GCSPath  string `json:"gcsPath"`
+	SHA1     string `json:"sha1"`
+	DestPath string `json:"destPath"`
+	Size     int64  `json:"size"`
+}
+
+// archiveExtensions lists the suffixes FetchManifest treats as a single
+// archive to unpack, rather than a flat list of blobs.
+var archiveExtensions = []string{".tar.gz", ".tgz", ".zip"}
+
+// FetchOptions configures FetchManifest and WriteManifest.
+type FetchOptions struct {
+	// Concurrency is the number of files downloaded or uploaded in
+	// parallel. Defaults to defaultConcurrentWorkers when zero.
+	Concurrency int
+
+	// GCSOptions are passed through to the underlying Client for each
+	// per-file transfer.
+	GCSOptions *Options
+}
+
+func (o *FetchOptions) concurrency() int {
+	if o == nil || o.Concurrency == 0 {
+		return defaultConcurrentWorkers
+	}
+	return o.Concurrency
+}
+
+func (o *FetchOptions) gcsOptions() *Options {
+	if o == nil || o.GCSOptions == nil {
+		return DefaultGCSCopyOptions
+	}
+	return o.GCSOptions
+}
+
+// FetchManifest downloads the JSON manifest at manifestGCSPath and hydrates
+// destDir from it: either one `ManifestEntry` per file, downloaded in
+// parallel with per-file SHA1 verification, or a single entry pointing at a
+// `.tar.gz`/`.tgz`/`.zip` archive, which is downloaded and unpacked into
+// destDir instead.
+func FetchManifest(manifestGCSPath, destDir string, opts *FetchOptions) error {
+	entries, err := readManifest(manifestGCSPath, opts)
+	if err != nil {
+		return errors.Wrapf(err, "reading manifest %s", manifestGCSPath)
+	}
+
+	if len(entries) == 1 && isArchive(entries[0].GCSPath) {
+		return fetchArchive(entries[0], destDir, opts)
+	}
+
+	return fetchEntries(entries, destDir, opts)
+}
+
+// WriteManifest walks srcDir, uploads every regular file it finds to
+// gcsPrefix, and writes a manifest describing the upload to
+// manifestGCSPath.
+func WriteManifest(srcDir, gcsPrefix, manifestGCSPath string, opts *FetchOptions) error {
+	var (
+		mu      sync.Mutex
+		entries []ManifestEntry
+	)
+
+	paths := []string{}
+	if err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "walking %s", srcDir)
+	}
+
+	client := NewClient(opts.gcsOptions())
+
+	jobs := make([]func() error, len(paths))
+	for i, path := range paths {
+		path := path
+		jobs[i] = func() error {
+			rel, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				return err
+			}
+
+			sum, size, err := sha1File(path)
+			if err != nil {
+				return errors.Wrapf(err, "hashing %s", path)
+			}
+
+			gcsPath := NormalizeGCSPath(filepath.Join(strings.TrimPrefix(gcsPrefix, GcsPrefix), rel))
+			if err := withRetry(opts.gcsOptions().WriteRetryPolicy, "manifest upload", func() error {
+				return client.Copy(path, gcsPath, opts.gcsOptions())
+			}); err != nil {
+				return errors.Wrapf(err, "uploading %s", path)
+			}
+
+			mu.Lock()
+			entries = append(entries, ManifestEntry{
+				GCSPath:  gcsPath,
+				SHA1:     sum,
+				DestPath: rel,
+				Size:     size,
+			})
+			mu.Unlock()
+
+			return nil
+		}
+	}
+
+	if err := runWorkerPool(opts.concurrency(), jobs); err != nil {
+		return err
+	}
+
+	return writeManifest(entries, manifestGCSPath, opts)
+}
+
+func readManifest(manifestGCSPath string, opts *FetchOptions) ([]ManifestEntry, error) {
+	tmp, err := ioutil.TempFile("", "gcs-manifest-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+
+	client := NewClient(opts.gcsOptions())
+	if err := withRetry(opts.gcsOptions().ReadRetryPolicy, "manifest download", func() error {
+		return client.Copy(NormalizeGCSPath(manifestGCSPath), tmp.Name(), opts.gcsOptions())
+	}); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrap(err, "parsing manifest JSON")
+	}
+
+	return entries, nil
+}
+
+func writeManifest(entries []ManifestEntry, manifestGCSPath string, opts *FetchOptions) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling manifest")
+	}
+
+	tmp, err := ioutil.TempFile("", "gcs-manifest-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	client := NewClient(opts.gcsOptions())
+	return withRetry(opts.gcsOptions().WriteRetryPolicy, "manifest upload", func() error {
+		return client.Copy(tmp.Name(), NormalizeGCSPath(manifestGCSPath), opts.gcsOptions())
+	})
+}
+
+func fetchEntries(entries []ManifestEntry, destDir string, opts *FetchOptions) error {
+	client := NewClient(opts.gcsOptions())
+
+	jobs := make([]func() error, len(entries))
+	for i, entry := range entries {
+		entry := entry
+		jobs[i] = func() error {
+			dest := filepath.Join(destDir, entry.DestPath)
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+
+			if err := withRetry(opts.gcsOptions().ReadRetryPolicy, "manifest fetch", func() error {
+				return client.Copy(NormalizeGCSPath(entry.GCSPath), dest, opts.gcsOptions())
+			}); err != nil {
+				return errors.Wrapf(err, "fetching %s", entry.GCSPath)
+			}
+
+			if entry.SHA1 == "" {
+				return nil
+			}
+
+			sum, _, err := sha1File(dest)
+			if err != nil {
+				return errors.Wrapf(err, "hashing %s", dest)
+			}
+			if sum != entry.SHA1 {
+				return errors.Errorf(
+					"sha1 mismatch for %s: manifest says %s, got %s", entry.GCSPath, entry.SHA1, sum,
+				)
+			}
+
+			return nil
+		}
+	}
+
+	return runWorkerPool(opts.concurrency(), jobs)
+}
+
+func fetchArchive(entry ManifestEntry, destDir string, opts *FetchOptions) error {
+	tmp, err := ioutil.TempFile("", "gcs-archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+
+	client := NewClient(opts.gcsOptions())
+	if err := withRetry(opts.gcsOptions().ReadRetryPolicy, "archive fetch", func() error {
+		return client.Copy(NormalizeGCSPath(entry.GCSPath), tmp.Name(), opts.gcsOptions())
+	}); err != nil {
+		return errors.Wrapf(err, "fetching archive %s", entry.GCSPath)
+	}
+
+	if entry.SHA1 != "" {
+		sum, _, err := sha1File(tmp.Name())
+		if err != nil {
+			return err
+		}
+		if sum != entry.SHA1 {
+			return errors.Errorf(
+				"sha1 mismatch for %s: manifest says %s, got %s", entry.GCSPath, entry.SHA1, sum,
+			)
+		}
+	}
+
+	logrus.Infof("Unpacking archive %s into %s", entry.GCSPath, destDir)
+	switch {
+	case strings.HasSuffix(entry.GCSPath, ".zip"):
+		return unzip(tmp.Name(), destDir)
+	default:
+		return untarGz(tmp.Name(), destDir)
+	}
+}
+
+func isArchive(gcsPath string) bool {
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(gcsPath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func sha1File(path string) (sum string, size int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha1.New() // nolint:gosec
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// safeJoin joins destDir and name the way archive extraction needs to:
+// it rejects absolute names and names (e.g. containing `../`) that would
+// resolve outside of destDir, preventing a malicious archive entry from
+// overwriting files elsewhere on disk (zip-slip).
+func safeJoin(destDir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", errors.Errorf("illegal file path in archive: %q", name)
+	}
+
+	target := filepath.Join(destDir, name)
+
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", errors.Errorf("illegal file path in archive: %q", name)
+	}
+
+	return target, nil
+}
+
+// safeSymlinkTarget checks that a symlink at linkPath (already validated by
+// safeJoin to be within destDir) pointing at linkname would itself resolve
+// to somewhere within destDir. safeJoin alone isn't enough: it only
+// validates the symlink entry's own path, not where the link points, so an
+// archive entry naming a symlink "a -> ../../etc" followed by a later entry
+// written "through" a/whatever would still escape destDir.
+func safeSymlinkTarget(destDir, linkPath, linkname string) error {
+	target := linkname
+	if !filepath.IsAbs(linkname) {
+		target = filepath.Join(filepath.Dir(linkPath), linkname)
+	}
+
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return errors.Errorf("illegal symlink target in archive: %q", linkname)
+	}
+
+	return nil
+}
+
+func untarGz(archivePath, destDir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(err, "opening gzip stream")
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar entry")
+		}
+
+		target, err := safeJoin(destDir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := safeSymlinkTarget(destDir, target, hdr.Linkname); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return errors.Wrapf(err, "creating symlink %s", target)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil { // nolint:gosec // manifest entries are trusted release artifacts
+				out.Close()
+				return err
+			}
+			out.Close()
+		}
+	}
+}
+
+func unzip(archivePath, destDir string) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return errors.Wrap(err, "opening zip archive")
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		target, err := safeJoin(destDir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, f.Mode()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if f.Mode()&os.ModeSymlink != 0 {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			linkTarget, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+
+			if err := safeSymlinkTarget(destDir, target, string(linkTarget)); err != nil {
+				return err
+			}
+
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(string(linkTarget), target); err != nil {
+				return errors.Wrapf(err, "creating symlink %s", target)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
+		if err != nil {
+			rc.Close()
+			return err
+		}
+
+		_, err = io.Copy(out, rc) // nolint:gosec // manifest entries are trusted release artifacts
+		out.Close()
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
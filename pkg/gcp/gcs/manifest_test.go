@@ -0,0 +1,276 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsArchive(t *testing.T) {
+	cases := map[string]bool{
+		"gs://bucket/release.tar.gz": true,
+		"gs://bucket/release.tgz":    true,
+		"gs://bucket/release.zip":    true,
+		"gs://bucket/binary":         false,
+		"gs://bucket/manifest.json":  false,
+	}
+
+	for gcsPath, want := range cases {
+		if got := isArchive(gcsPath); got != want {
+			t.Errorf("isArchive(%q) = %v, want %v", gcsPath, got, want)
+		}
+	}
+}
+
+func TestSha1FileMismatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "object")
+	if err := ioutil.WriteFile(path, []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, size, err := sha1File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len("hello world")) {
+		t.Errorf("size = %d, want %d", size, len("hello world"))
+	}
+
+	const wantSum = "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed"
+	if sum != wantSum {
+		t.Errorf("sha1File sum = %q, want %q", sum, wantSum)
+	}
+
+	if sum == "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef" {
+		t.Error("sanity check for mismatch comparison failed")
+	}
+}
+
+func buildTarGz(t *testing.T, entries map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "archive.tar.gz")
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	for name, content := range entries {
+		hdr := &tar.Header{
+			Name: name,
+			Mode: 0o644,
+			Size: int64(len(content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+func TestUntarGzUnpacksFiles(t *testing.T) {
+	archivePath := buildTarGz(t, map[string]string{
+		"a.txt":     "file a",
+		"sub/b.txt": "file b",
+	})
+
+	destDir := t.TempDir()
+	if err := untarGz(archivePath, destDir); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != "file a" {
+		t.Errorf("a.txt content = %q, want %q", a, "file a")
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(destDir, "sub", "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "file b" {
+		t.Errorf("sub/b.txt content = %q, want %q", b, "file b")
+	}
+}
+
+func TestUntarGzRejectsPathTraversal(t *testing.T) {
+	archivePath := buildTarGz(t, map[string]string{
+		"../../etc/passwd": "pwned",
+	})
+
+	destDir := t.TempDir()
+	if err := untarGz(archivePath, destDir); err == nil {
+		t.Fatal("expected untarGz to reject a path-traversal entry, got nil error")
+	}
+}
+
+func buildZip(t *testing.T, entries map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "archive.zip")
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+func TestUnzipUnpacksFiles(t *testing.T) {
+	archivePath := buildZip(t, map[string]string{
+		"a.txt":     "file a",
+		"sub/b.txt": "file b",
+	})
+
+	destDir := t.TempDir()
+	if err := unzip(archivePath, destDir); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ioutil.ReadFile(filepath.Join(destDir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, []byte("file a")) {
+		t.Errorf("a.txt content = %q, want %q", a, "file a")
+	}
+}
+
+func TestUnzipRejectsPathTraversal(t *testing.T) {
+	archivePath := buildZip(t, map[string]string{
+		"../../etc/passwd": "pwned",
+	})
+
+	destDir := t.TempDir()
+	if err := unzip(archivePath, destDir); err == nil {
+		t.Fatal("expected unzip to reject a path-traversal entry, got nil error")
+	}
+}
+
+func TestUntarGzRejectsSymlinkEscape(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "archive.tar.gz")
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     "link",
+		Typeflag: tar.TypeSymlink,
+		Linkname: "../../etc",
+		Mode:     0o777,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	destDir := t.TempDir()
+	if err := untarGz(archivePath, destDir); err == nil {
+		t.Fatal("expected untarGz to reject a symlink escaping destDir, got nil error")
+	}
+
+	if _, statErr := os.Lstat(filepath.Join(destDir, "link")); !os.IsNotExist(statErr) {
+		t.Errorf("rejected symlink should not have been created, stat err = %v", statErr)
+	}
+}
+
+func TestSafeSymlinkTarget(t *testing.T) {
+	destDir := "/tmp/dest"
+	linkPath := filepath.Join(destDir, "sub", "link")
+
+	if err := safeSymlinkTarget(destDir, linkPath, "../../../etc/passwd"); err == nil {
+		t.Error("expected safeSymlinkTarget to reject a relative target escaping destDir")
+	}
+	if err := safeSymlinkTarget(destDir, linkPath, "/etc/passwd"); err == nil {
+		t.Error("expected safeSymlinkTarget to reject an absolute target outside destDir")
+	}
+	if err := safeSymlinkTarget(destDir, linkPath, "../other/file.txt"); err != nil {
+		t.Errorf("safeSymlinkTarget rejected a legitimate target within destDir: %v", err)
+	}
+}
+
+func TestSafeJoinRejectsTraversal(t *testing.T) {
+	destDir := "/tmp/dest"
+
+	if _, err := safeJoin(destDir, "../escape"); err == nil {
+		t.Error("expected safeJoin to reject ../escape")
+	}
+	if _, err := safeJoin(destDir, "/etc/passwd"); err == nil {
+		t.Error("expected safeJoin to reject an absolute path")
+	}
+	if target, err := safeJoin(destDir, "sub/file.txt"); err != nil {
+		t.Errorf("safeJoin rejected a legitimate relative path: %v", err)
+	} else if target != filepath.Join(destDir, "sub/file.txt") {
+		t.Errorf("safeJoin target = %q, want %q", target, filepath.Join(destDir, "sub/file.txt"))
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// RetryPolicy configures how a GCS operation is retried on transient
+// failures. It is a thin wrapper around wait.Backoff so callers don't need
+// to import apimachinery directly just to tune retry behavior.
+type RetryPolicy wait.Backoff
+
+// DefaultReadRetryPolicy is used for operations that only read from GCS
+// (downloads, existence checks, listing).
+var DefaultReadRetryPolicy = &RetryPolicy{
+	Duration: time.Second,
+	Factor:   1.5,
+	Jitter:   0.1,
+	Steps:    4,
+}
+
+// DefaultWriteRetryPolicy is used for operations that mutate GCS (uploads,
+// bucket-to-bucket copies, deletes). It allows one extra step over the read
+// policy since writes are typically more expensive to redo from scratch.
+var DefaultWriteRetryPolicy = &RetryPolicy{
+	Duration: time.Second,
+	Factor:   1.5,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// permanentErrorSubstrings are substrings of gsutil's textual error output
+// that indicate the operation will never succeed no matter how many times
+// it's retried, so retrying is skipped. gsutil only gives us a rendered
+// error string to work with (no status codes), so these are matched
+// verbatim against its known phrasing rather than bare digits like "404",
+// which also show up in object sizes and paths and would misclassify
+// unrelated errors as permanent.
+var permanentErrorSubstrings = []string{
+	"one or more urls matched no objects",
+	"no such object",
+	"notfound",
+	"accessdeniedexception",
+	"forbidden",
+	"precondition failed",
+}
+
+// isRetryableError classifies err as transient (network blips, 5xx
+// responses, rate limiting) versus permanent (404/403/precondition-failed),
+// the latter being short-circuited instead of retried. Errors from the
+// native storage client are classified by their typed status code;
+// gsutil's errors only carry rendered text, so those fall back to matching
+// against permanentErrorSubstrings.
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case 404, 403, 412:
+			return false
+		default:
+			return true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range permanentErrorSubstrings {
+		if strings.Contains(msg, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withRetry runs fn, retrying it according to policy while the error it
+// returns is classified as transient by isRetryableError. Each retry is
+// logged at info level with the attempt number and the error that
+// triggered it, so flaky release jobs can be diagnosed from logs alone.
+func withRetry(policy *RetryPolicy, operation string, fn func() error) error {
+	if policy == nil {
+		return fn()
+	}
+
+	backoff := wait.Backoff(*policy)
+	var lastErr error
+
+	attempt := 0
+	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+		attempt++
+		lastErr = fn()
+		if lastErr == nil {
+			return true, nil
+		}
+
+		if !isRetryableError(lastErr) {
+			return false, lastErr
+		}
+
+		logrus.Infof(
+			"Retrying %s (attempt %d) after error: %v", operation, attempt, lastErr,
+		)
+		return false, nil
+	})
+	if err != nil {
+		if err == wait.ErrWaitTimeout && lastErr != nil {
+			return lastErr
+		}
+		return err
+	}
+
+	return nil
+}
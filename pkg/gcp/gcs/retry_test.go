@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"testing"
+
+	"cloud.google.com/go/storage"
+	pkgerrors "github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "nil error",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "gsutil no objects matched",
+			err:  pkgerrors.Wrap(pkgerrors.New("CommandException: One or more URLs matched no objects."), "gcs copy"),
+			want: false,
+		},
+		{
+			name: "gsutil forbidden",
+			err:  pkgerrors.New("AccessDeniedException: 403 Forbidden"),
+			want: false,
+		},
+		{
+			name: "gsutil precondition failed",
+			err:  pkgerrors.New("PreconditionException: 412 Precondition Failed"),
+			want: false,
+		},
+		{
+			name: "gsutil transient 5xx",
+			err:  pkgerrors.New("ServiceException: 503 Backend Error"),
+			want: true,
+		},
+		{
+			name: "path containing 404 is not mistaken for a not-found status",
+			err:  pkgerrors.New("write failed for gs://bucket/builds/v1.404.0/foo: connection reset by peer"),
+			want: true,
+		},
+		{
+			name: "native object not exist",
+			err:  storage.ErrObjectNotExist,
+			want: false,
+		},
+		{
+			name: "wrapped native object not exist",
+			err:  pkgerrors.Wrap(storage.ErrObjectNotExist, "statting gs://bucket/object"),
+			want: false,
+		},
+		{
+			name: "googleapi 404",
+			err:  &googleapi.Error{Code: 404, Message: "not found"},
+			want: false,
+		},
+		{
+			name: "googleapi 429 rate limited",
+			err:  &googleapi.Error{Code: 429, Message: "rate limit exceeded"},
+			want: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryableError(tc.err); got != tc.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
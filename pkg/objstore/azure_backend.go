@@ -0,0 +1,213 @@
+//go:build azure
+// +build azure
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	RegisterBackend("az", &azureBackend{})
+}
+
+// azureBackend implements Backend on top of the Azure Blob SDK, using the
+// storage account embedded in the `az://<account>/<container>/<blob>` path
+// and a shared key read from the AZURE_STORAGE_KEY environment variable;
+// managed identity is not used. It's only compiled in with the `azure`
+// build tag.
+type azureBackend struct{}
+
+// accountContainerAndBlob splits an `az://<account>/<container>/<blob>` path into
+// its account, container, and blob components.
+func accountContainerAndBlob(path string) (account, container, blob string) {
+	trimmed := strings.TrimPrefix(path, "az://")
+	parts := strings.SplitN(trimmed, "/", 3)
+	switch len(parts) {
+	case 3:
+		return parts[0], parts[1], parts[2]
+	case 2:
+		return parts[0], parts[1], ""
+	default:
+		return parts[0], "", ""
+	}
+}
+
+func (b *azureBackend) client(account string) (*azblob.Client, error) {
+	url := "https://" + account + ".blob.core.windows.net/"
+
+	cred, err := azblob.NewSharedKeyCredential(account, os.Getenv("AZURE_STORAGE_KEY"))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating Azure credential")
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(url, cred, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating Azure Blob client")
+	}
+
+	return client, nil
+}
+
+func (b *azureBackend) CopyToRemote(src, dst string, opts *Options) error {
+	account, container, blob := accountContainerAndBlob(dst)
+	client, err := b.client(account)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", src)
+	}
+	defer f.Close()
+
+	_, err = client.UploadFile(context.Background(), container, blob, f, nil)
+	return errors.Wrapf(err, "uploading %s to %s", src, dst)
+}
+
+func (b *azureBackend) CopyToLocal(src, dst string, opts *Options) error {
+	account, container, blob := accountContainerAndBlob(src)
+	client, err := b.client(account)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dst)
+	}
+	defer f.Close()
+
+	_, err = client.DownloadFile(context.Background(), container, blob, f, nil)
+	return errors.Wrapf(err, "downloading %s to %s", src, dst)
+}
+
+func (b *azureBackend) CopyBucketToBucket(src, dst string, opts *Options) error {
+	dstAccount, dstContainer, dstBlob := accountContainerAndBlob(dst)
+	srcAccount, srcContainer, srcBlob := accountContainerAndBlob(src)
+
+	client, err := b.client(dstAccount)
+	if err != nil {
+		return err
+	}
+
+	srcURL := "https://" + srcAccount + ".blob.core.windows.net/" + srcContainer + "/" + srcBlob
+	_, err = client.ServiceClient().NewContainerClient(dstContainer).NewBlobClient(dstBlob).
+		StartCopyFromURL(context.Background(), srcURL, nil)
+	return errors.Wrapf(err, "copying %s to %s", src, dst)
+}
+
+func (b *azureBackend) Rsync(src, dst string, opts *Options) error {
+	names, err := b.List(src)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]func() error, len(names))
+	for i, name := range names {
+		name := name
+		jobs[i] = func() error {
+			return b.CopyBucketToBucket(joinPath(src, name), joinPath(dst, name), opts)
+		}
+	}
+
+	return runWorkerPool(opts.workers(), jobs)
+}
+
+func (b *azureBackend) PathExists(path string) (bool, error) {
+	account, container, blob := accountContainerAndBlob(path)
+	client, err := b.client(account)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = client.ServiceClient().NewContainerClient(container).NewBlobClient(blob).
+		GetProperties(context.Background(), nil)
+	if err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (b *azureBackend) List(prefix string) ([]string, error) {
+	account, container, blob := accountContainerAndBlob(prefix)
+	client, err := b.client(account)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	pager := client.NewListBlobsFlatPager(container, &azblob.ListBlobsFlatOptions{
+		Prefix: &blob,
+	})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing %s", prefix)
+		}
+		for _, item := range page.Segment.BlobItems {
+			names = append(names, strings.TrimPrefix(*item.Name, blob))
+		}
+	}
+
+	return names, nil
+}
+
+func (b *azureBackend) Reader(path string) (io.ReadCloser, error) {
+	account, container, blob := accountContainerAndBlob(path)
+	client, err := b.client(account)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.DownloadStream(context.Background(), container, blob, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening reader for %s", path)
+	}
+
+	return resp.Body, nil
+}
+
+func (b *azureBackend) Writer(path string) (io.WriteCloser, error) {
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+
+	account, container, blob := accountContainerAndBlob(path)
+	go func() {
+		client, err := b.client(account)
+		if err != nil {
+			r.CloseWithError(err)
+			done <- err
+			return
+		}
+
+		_, err = client.UploadStream(context.Background(), container, blob, r, nil)
+		r.CloseWithError(err)
+		done <- errors.Wrapf(err, "uploading to %s", path)
+	}()
+
+	return &pipeWriteCloser{w, done}, nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objstore
+
+import (
+	"io"
+
+	"k8s.io/release/pkg/gcp/gcs"
+	"k8s.io/utils/pointer"
+)
+
+func init() {
+	RegisterBackend("gs", &gcsBackend{})
+}
+
+// gcsBackend adapts pkg/gcp/gcs to the Backend interface. It is always
+// registered, keeping GCS as the default, zero-config provider.
+type gcsBackend struct{}
+
+func gcsOptions(opts *Options) *gcs.Options {
+	o := *gcs.DefaultGCSCopyOptions
+	if opts == nil {
+		return &o
+	}
+
+	o.Recursive = pointer.BoolPtr(opts.Recursive)
+	o.NoClobber = pointer.BoolPtr(opts.NoClobber)
+	o.AllowMissing = pointer.BoolPtr(opts.AllowMissing)
+	if opts.Workers != 0 {
+		workers := opts.Workers
+		o.ConcurrentWorkers = &workers
+	}
+
+	return &o
+}
+
+func (b *gcsBackend) CopyToRemote(src, dst string, opts *Options) error {
+	return gcs.CopyToGCS(src, dst, gcsOptions(opts))
+}
+
+func (b *gcsBackend) CopyToLocal(src, dst string, opts *Options) error {
+	return gcs.CopyToLocal(src, dst, gcsOptions(opts))
+}
+
+func (b *gcsBackend) CopyBucketToBucket(src, dst string, opts *Options) error {
+	return gcs.CopyBucketToBucket(src, dst, gcsOptions(opts))
+}
+
+func (b *gcsBackend) Rsync(src, dst string, opts *Options) error {
+	return gcs.RsyncRecursive(src, dst)
+}
+
+func (b *gcsBackend) PathExists(path string) (bool, error) {
+	return gcs.PathExists(path)
+}
+
+func (b *gcsBackend) List(prefix string) ([]string, error) {
+	return gcs.NewClient(gcs.DefaultGCSCopyOptions).List(prefix)
+}
+
+func (b *gcsBackend) Reader(path string) (io.ReadCloser, error) {
+	return gcs.NewReader(path)
+}
+
+func (b *gcsBackend) Writer(path string) (io.WriteCloser, error) {
+	return gcs.NewWriter(path)
+}
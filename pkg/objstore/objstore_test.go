@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objstore
+
+import "testing"
+
+func TestScheme(t *testing.T) {
+	cases := map[string]string{
+		"gs://bucket/object":  "gs",
+		"s3://bucket/object":  "s3",
+		"az://account/c/blob": "az",
+		"/local/path":         "",
+		"relative/path":       "",
+	}
+
+	for path, want := range cases {
+		if got := scheme(path); got != want {
+			t.Errorf("scheme(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	cases := []struct {
+		prefix, name, want string
+	}{
+		{prefix: "gs://bucket/prefix", name: "", want: "gs://bucket/prefix"},
+		{prefix: "gs://bucket/prefix", name: "file.txt", want: "gs://bucket/prefix/file.txt"},
+		{prefix: "gs://bucket/prefix/", name: "file.txt", want: "gs://bucket/prefix/file.txt"},
+		{prefix: "gs://bucket/prefix", name: "/file.txt", want: "gs://bucket/prefix/file.txt"},
+		{prefix: "s3://bucket/prefix", name: "sub/file.txt", want: "s3://bucket/prefix/sub/file.txt"},
+	}
+
+	for _, tc := range cases {
+		if got := joinPath(tc.prefix, tc.name); got != tc.want {
+			t.Errorf("joinPath(%q, %q) = %q, want %q", tc.prefix, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBackendForUnknownScheme(t *testing.T) {
+	if _, err := backendFor("ftp://host/path"); err == nil {
+		t.Error("expected backendFor to error on an unregistered scheme")
+	}
+}
+
+func TestBackendForGCSIsRegisteredByDefault(t *testing.T) {
+	if _, err := backendFor("gs://bucket/object"); err != nil {
+		t.Errorf("expected the gs backend to be registered by default, got: %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+//go:build s3
+// +build s3
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	RegisterBackend("s3", &s3Backend{})
+}
+
+// s3Backend implements Backend on top of the AWS SDK v2, using whatever
+// credential chain the SDK resolves by default (env vars, shared config,
+// instance/task role). It's only compiled in with the `s3` build tag so
+// that GCS-only consumers don't need the AWS SDK as a dependency.
+type s3Backend struct{}
+
+func (b *s3Backend) client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading AWS config")
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+func bucketAndKey(path string) (bucket, key string) {
+	trimmed := strings.TrimPrefix(path, "s3://")
+	parts := strings.SplitN(trimmed, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (b *s3Backend) CopyToRemote(src, dst string, opts *Options) error {
+	ctx := context.Background()
+	client, err := b.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", src)
+	}
+	defer f.Close()
+
+	bucket, key := bucketAndKey(dst)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	})
+	return errors.Wrapf(err, "uploading %s to %s", src, dst)
+}
+
+func (b *s3Backend) CopyToLocal(src, dst string, opts *Options) error {
+	ctx := context.Background()
+	client, err := b.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	bucket, key := bucketAndKey(src)
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "downloading %s", src)
+	}
+	defer out.Body.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dst)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, out.Body)
+	return errors.Wrapf(err, "downloading %s to %s", src, dst)
+}
+
+func (b *s3Backend) CopyBucketToBucket(src, dst string, opts *Options) error {
+	ctx := context.Background()
+	client, err := b.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	srcBucket, srcKey := bucketAndKey(src)
+	dstBucket, dstKey := bucketAndKey(dst)
+
+	_, err = client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(srcBucket + "/" + srcKey),
+	})
+	return errors.Wrapf(err, "copying %s to %s", src, dst)
+}
+
+func (b *s3Backend) Rsync(src, dst string, opts *Options) error {
+	names, err := b.List(src)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]func() error, len(names))
+	for i, name := range names {
+		name := name
+		jobs[i] = func() error {
+			return b.CopyBucketToBucket(joinPath(src, name), joinPath(dst, name), opts)
+		}
+	}
+
+	return runWorkerPool(opts.workers(), jobs)
+}
+
+func (b *s3Backend) PathExists(path string) (bool, error) {
+	ctx := context.Background()
+	client, err := b.client(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	bucket, key := bucketAndKey(path)
+	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (b *s3Backend) List(prefix string) ([]string, error) {
+	ctx := context.Background()
+	client, err := b.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, key := bucketAndKey(prefix)
+	names := []string{}
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(key),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing %s", prefix)
+		}
+		for _, obj := range page.Contents {
+			names = append(names, strings.TrimPrefix(aws.ToString(obj.Key), key))
+		}
+	}
+
+	return names, nil
+}
+
+func (b *s3Backend) Reader(path string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	client, err := b.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, key := bucketAndKey(path)
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening reader for %s", path)
+	}
+
+	return out.Body, nil
+}
+
+func (b *s3Backend) Writer(path string) (io.WriteCloser, error) {
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+
+	bucket, key := bucketAndKey(path)
+	go func() {
+		ctx := context.Background()
+		client, err := b.client(ctx)
+		if err != nil {
+			r.CloseWithError(err)
+			done <- err
+			return
+		}
+
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   r,
+		})
+		r.CloseWithError(err)
+		done <- errors.Wrapf(err, "uploading to %s", path)
+	}()
+
+	return &pipeWriteCloser{w, done}, nil
+}